@@ -1,17 +1,39 @@
 package pgmigrate
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
+	"time"
 )
 
+// advisoryLockPollInterval is how often MigrateUp/MigrateDown retry
+// pg_try_advisory_lock while a WithLockTimeout is in effect.
+const advisoryLockPollInterval = 100 * time.Millisecond
+
+// directiveRegex matches a single pgmigrate directive comment in a
+// migration file's header, e.g. "-- pgmigrate:no-transaction".
+var directiveRegex = regexp.MustCompile(`^--\s*pgmigrate:(\S+)\s*$`)
+
+// noTransactionDirective marks a migration as needing to run outside of the
+// outer batch transaction, e.g. CREATE INDEX CONCURRENTLY. It's the only
+// supported way to escape the transactional wrapper.
+const noTransactionDirective = "no-transaction"
+
 var ErrNoMigrations = fmt.Errorf("no migrations found")
 
 type Logger interface {
@@ -20,10 +42,18 @@ type Logger interface {
 }
 
 type migrator struct {
-	db        *sql.DB
-	basePath  string
-	fileRegex *regexp.Regexp
-	logger    Logger
+	db                    *sql.DB
+	fsys                  fs.FS
+	dir                   string
+	fileRegex             *regexp.Regexp
+	logger                Logger
+	migrations            map[int]Migration
+	allowChecksumMismatch bool
+	lockKey               int64
+	lockTimeout           time.Duration
+	templateData          map[string]any
+	hooks                 Hooks
+	dryRun                bool
 }
 
 type migrationFile struct {
@@ -31,30 +61,685 @@ type migrationFile struct {
 	Name    string `json:"name"`
 }
 
-// NewMigrator creates a new migrator instance.
-func NewMigrator(db *sql.DB, logger Logger, basePath string) (*migrator, error) {
-	if _, err := db.Exec(
-		`CREATE TABLE IF NOT EXISTS __migrations (
-			version int PRIMARY KEY,
-			name TEXT NOT NULL
-		)`,
-	); err != nil {
+// Migration is a migration registered in Go code rather than as a pair of
+// SQL files on disk. This unlocks migrations that need Go logic that pure
+// SQL can't express, such as data backfills or calls to external services.
+// UpFunc and DownFunc run in the same transaction as the rest of the
+// migration batch; either may be left nil if that direction isn't supported,
+// in which case migrating in that direction fails once this version is
+// reached.
+type Migration struct {
+	Version  int
+	Name     string
+	UpFunc   func(ctx context.Context, tx *sql.Tx) error
+	DownFunc func(ctx context.Context, tx *sql.Tx) error
+}
+
+// MigrationStatus describes the state of a single migration version, whether
+// it's been applied, still available to apply (as a SQL file on disk or a
+// migration registered in code), and whether its on-disk contents still
+// match what was applied.
+type MigrationStatus struct {
+	Version       int
+	Name          string
+	Applied       bool
+	AppliedAt     *time.Time
+	Available     bool
+	ChecksumMatch bool
+}
+
+// Direction indicates which way a migration is being run, passed to Hooks so
+// callers can tell a rollback from a forward migration.
+type Direction string
+
+const (
+	DirectionUp   Direction = "up"
+	DirectionDown Direction = "down"
+)
+
+// Hooks lets callers observe and gate migration execution, e.g. to emit
+// OpenTelemetry spans per migration, send a Slack notification on failure,
+// run ANALYZE after each up migration, or require approval before a down
+// migration runs. BeforeEach/AfterEach wrap each individual migration;
+// BeforeAll/AfterAll wrap the whole MigrateUp/MigrateDown call. Returning an
+// error from BeforeAll, BeforeEach or AfterEach aborts the run, rolling back
+// the in-flight transaction the same way a failing migration would. AfterAll
+// runs after the batch transaction has been committed or rolled back, so its
+// error is returned but undoes nothing; likewise, a migration carrying the
+// no-transaction directive has already run (and, if it succeeded, been
+// recorded in __migrations) by the time its AfterEach is called.
+type Hooks interface {
+	BeforeAll(ctx context.Context, direction Direction) error
+	AfterAll(ctx context.Context, direction Direction, err error) error
+	BeforeEach(ctx context.Context, direction Direction, mg Migration) error
+	AfterEach(ctx context.Context, direction Direction, mg Migration, err error) error
+}
+
+// PlannedMigration is a single step of a Plan: one migration and the
+// direction it would run in.
+type PlannedMigration struct {
+	Migration Migration
+	Direction Direction
+}
+
+// Plan describes the ordered sequence of migrations that MigrateUp would
+// apply, as returned by the migrator's Plan method, without executing any of
+// them.
+type Plan struct {
+	Migrations []PlannedMigration
+}
+
+// Option configures a migrator created by NewMigrator or NewMigratorFS.
+type Option func(*migrator)
+
+// WithAllowChecksumMismatch allows MigrateUp to proceed even when a
+// previously applied migration's on-disk contents no longer match the
+// checksum recorded when it was applied. Without this option, MigrateUp
+// refuses to run when it detects such drift.
+func WithAllowChecksumMismatch() Option {
+	return func(m *migrator) {
+		m.allowChecksumMismatch = true
+	}
+}
+
+// WithLockKey overrides the Postgres session advisory lock key that
+// MigrateUp/MigrateDown use to serialize concurrent runs against the same
+// database. By default the key is a hash of the unqualified migrations
+// table name, which is the same for every migrator, so migrators working in
+// different schemas of one database share the same lock.
+func WithLockKey(key int64) Option {
+	return func(m *migrator) {
+		m.lockKey = key
+	}
+}
+
+// WithLockTimeout bounds how long MigrateUp/MigrateDown wait to acquire the
+// advisory lock before giving up, polling with pg_try_advisory_lock. Without
+// this option the migrator blocks indefinitely on pg_advisory_lock.
+func WithLockTimeout(d time.Duration) Option {
+	return func(m *migrator) {
+		m.lockTimeout = d
+	}
+}
+
+// WithTemplateData makes data available to migration files as text/template
+// variables, e.g. a file containing "{{ .Schema }}.widgets" with
+// WithTemplateData(map[string]any{"Schema": "app"}) renders to
+// "app.widgets" before it's executed.
+func WithTemplateData(data map[string]any) Option {
+	return func(m *migrator) {
+		m.templateData = data
+	}
+}
+
+// WithHooks registers Hooks to run around migration execution. Equivalent to
+// calling OnEvent right after NewMigrator/NewMigratorFS.
+func WithHooks(h Hooks) Option {
+	return func(m *migrator) {
+		m.hooks = h
+	}
+}
+
+// WithDryRun makes MigrateUp, MigrateDown and MigrateTo execute every
+// migration as usual but roll back the batch transaction at the end instead
+// of committing, so a run can be rehearsed against a real database without
+// leaving any changes behind. Migrations carrying the no-transaction
+// directive run outside that transaction and can't be rehearsed this way;
+// the run fails instead of silently committing them.
+func WithDryRun() Option {
+	return func(m *migrator) {
+		m.dryRun = true
+	}
+}
+
+// defaultLockKey derives a deterministic advisory lock key from the
+// migrations table name. The name hashed is the fixed, unqualified
+// "__migrations" (not schema-qualified), so every migrator using the
+// default key gets the same lock, whichever schema it works in.
+func defaultLockKey() int64 {
+	h := fnv.New64a()
+	h.Write([]byte("pgmigrate:__migrations"))
+	return int64(h.Sum64())
+}
+
+// NewMigrator creates a new migrator instance that reads migrations from the
+// directory basePath on the local filesystem.
+func NewMigrator(db *sql.DB, logger Logger, basePath string, opts ...Option) (*migrator, error) {
+	return NewMigratorFS(db, logger, os.DirFS(basePath), ".", opts...)
+}
+
+// NewMigratorFS creates a new migrator instance that reads migrations from
+// dir within fsys. This allows migrations to be embedded into the binary via
+// //go:embed instead of shipped alongside it, e.g.:
+//
+//	//go:embed migrations/*.sql
+//	var migrationsFS embed.FS
+//
+//	mg, err := pgmigrate.NewMigratorFS(db, logger, migrationsFS, "migrations")
+func NewMigratorFS(db *sql.DB, logger Logger, fsys fs.FS, dir string, opts ...Option) (*migrator, error) {
+	m := &migrator{
+		db:         db,
+		fsys:       fsys,
+		dir:        dir,
+		fileRegex:  regexp.MustCompile(`^(\d{10})_(.*)\.(up|down)\.sql$`),
+		logger:     logger,
+		migrations: make(map[int]Migration),
+		lockKey:    defaultLockKey(),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	// Bootstrap the bookkeeping table under the advisory lock, so that
+	// multiple app instances starting up at the same time don't race each
+	// other on the very first CREATE TABLE IF NOT EXISTS.
+	err := m.withAdvisoryLock(context.Background(), func(ctx context.Context, conn *sql.Conn) error {
+		if _, err := conn.ExecContext(
+			ctx,
+			`CREATE TABLE IF NOT EXISTS __migrations (
+				version int PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at timestamptz NOT NULL DEFAULT now(),
+				checksum text,
+				execution_ms int
+			)`,
+		); err != nil {
+			return err
+		}
+
+		// Upgrade the bookkeeping table for installs that predate applied_at,
+		// checksum and execution_ms.
+		if _, err := conn.ExecContext(
+			ctx,
+			`ALTER TABLE __migrations
+				ADD COLUMN IF NOT EXISTS applied_at timestamptz NOT NULL DEFAULT now(),
+				ADD COLUMN IF NOT EXISTS checksum text,
+				ADD COLUMN IF NOT EXISTS execution_ms int`,
+		); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return &migrator{
-		db:        db,
-		basePath:  basePath,
-		fileRegex: regexp.MustCompile(`^(\d{10})_(.*)\.(up|down)\.sql$`),
-		logger:    logger,
-	}, nil
+	return m, nil
+}
+
+// Register adds a Go migration, to be merged by version with the migrations
+// found on disk and applied/rolled back alongside them.
+func (m *migrator) Register(mg Migration) error {
+	if mg.Version == 0 {
+		return fmt.Errorf("registered migration must have a version")
+	}
+
+	if mg.Name == "" {
+		return fmt.Errorf("registered migration %d must have a name", mg.Version)
+	}
+
+	if _, exists := m.migrations[mg.Version]; exists {
+		return fmt.Errorf("migration %d is already registered", mg.Version)
+	}
+
+	m.migrations[mg.Version] = mg
+
+	return nil
+}
+
+// OnEvent registers hooks to run around migration execution, replacing any
+// hooks registered previously.
+func (m *migrator) OnEvent(h Hooks) {
+	m.hooks = h
+}
+
+// parseDirectives scans the leading comment lines of a migration file for
+// pgmigrate directives, returning whether the no-transaction directive was
+// present and the source with all directive lines stripped.
+func parseDirectives(src []byte) (noTransaction bool, stripped []byte, err error) {
+	lines := strings.Split(string(src), "\n")
+
+	var kept []string
+	inHeader := true
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if inHeader {
+			if trimmed == "" {
+				kept = append(kept, line)
+				continue
+			}
+
+			if strings.HasPrefix(trimmed, "--") {
+				if dm := directiveRegex.FindStringSubmatch(trimmed); dm != nil {
+					switch dm[1] {
+					case noTransactionDirective:
+						noTransaction = true
+					default:
+						return false, nil, fmt.Errorf("unknown pgmigrate directive %q", dm[1])
+					}
+					continue
+				}
+
+				kept = append(kept, line)
+				continue
+			}
+
+			inHeader = false
+		}
+
+		kept = append(kept, line)
+	}
+
+	return noTransaction, []byte(strings.Join(kept, "\n")), nil
+}
+
+// renderTemplate expands {{ .Var }}-style placeholders in a migration body
+// using the data supplied via WithTemplateData.
+func (m *migrator) renderTemplate(name string, body []byte) ([]byte, error) {
+	tmpl, err := template.New(name).Parse(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed parsing template for %s: %w", name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, m.templateData); err != nil {
+		return nil, fmt.Errorf("failed executing template for %s: %w", name, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// prepareStatement strips pgmigrate directives from a migration file and
+// renders its template placeholders, returning the statement ready to
+// execute and whether it requested the no-transaction directive.
+func (m *migrator) prepareStatement(name string, src []byte) (stmt []byte, noTransaction bool, err error) {
+	noTransaction, stripped, err := parseDirectives(src)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", name, err)
+	}
+
+	stmt, err = m.renderTemplate(name, stripped)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return stmt, noTransaction, nil
+}
+
+// availableMigrations returns every migration available to apply, merging
+// on-disk SQL files with migrations registered in code, sorted by version,
+// along with the SHA-256 checksum of each on-disk .up.sql file (registered
+// migrations have no checksum).
+func (m *migrator) availableMigrations() ([]migrationFile, map[int]string, error) {
+	files, err := fs.ReadDir(m.fsys, m.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		availableMigrations []migrationFile
+		matches             []string
+	)
+	checksums := make(map[int]string)
+
+	// Find all available migrations (up files)
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		matches = m.fileRegex.FindStringSubmatch(f.Name())
+		if len(matches) < 4 {
+			m.logger.Warnf("file %s is not formatted correctly", f.Name())
+			continue
+		}
+
+		if matches[3] != "up" {
+			continue
+		}
+
+		v, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed extracting version for %s: %w", f.Name(), err)
+		}
+
+		body, err := fs.ReadFile(m.fsys, path.Join(m.dir, f.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sum := sha256.Sum256(body)
+		checksums[v] = hex.EncodeToString(sum[:])
+
+		availableMigrations = append(availableMigrations, migrationFile{
+			Version: v,
+			Name:    matches[2],
+		})
+	}
+
+	// Merge in migrations registered in code
+	for _, gm := range m.migrations {
+		for _, f := range availableMigrations {
+			if f.Version == gm.Version {
+				return nil, nil, fmt.Errorf("migration %d is registered both as a Go migration and a SQL file", gm.Version)
+			}
+		}
+
+		availableMigrations = append(availableMigrations, migrationFile{
+			Version: gm.Version,
+			Name:    gm.Name,
+		})
+	}
+
+	sort.Slice(availableMigrations, func(i, j int) bool {
+		return availableMigrations[i].Version < availableMigrations[j].Version
+	})
+
+	return availableMigrations, checksums, nil
+}
+
+// Status returns the status of every migration known either from the
+// __migrations table or from the migrations available to apply (on disk and
+// registered in code).
+func (m *migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	available, checksums, err := m.availableMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	availableByVersion := make(map[int]migrationFile, len(available))
+	for _, a := range available {
+		availableByVersion[a.Version] = a
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, applied_at, checksum FROM __migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []MigrationStatus
+	seen := make(map[int]bool)
+	for rows.Next() {
+		var (
+			version   int
+			name      string
+			appliedAt time.Time
+			checksum  sql.NullString
+		)
+		if err := rows.Scan(&version, &name, &appliedAt, &checksum); err != nil {
+			return nil, err
+		}
+
+		seen[version] = true
+
+		status := MigrationStatus{
+			Version:       version,
+			Name:          name,
+			Applied:       true,
+			AppliedAt:     &appliedAt,
+			ChecksumMatch: true,
+		}
+
+		if a, ok := availableByVersion[version]; ok {
+			status.Available = true
+			status.Name = a.Name
+		}
+
+		if disk, ok := checksums[version]; ok && checksum.Valid && disk != checksum.String {
+			status.ChecksumMatch = false
+		}
+
+		statuses = append(statuses, status)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range available {
+		if seen[a.Version] {
+			continue
+		}
+
+		statuses = append(statuses, MigrationStatus{
+			Version:       a.Version,
+			Name:          a.Name,
+			Available:     true,
+			ChecksumMatch: true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Plan returns the ordered list of migrations that MigrateUp would apply,
+// without executing any of them, e.g. to preview a deployment's pending
+// migrations before a rollout.
+func (m *migrator) Plan(ctx context.Context) (*Plan, error) {
+	var plan *Plan
+
+	err := m.withAdvisoryLock(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		available, checksums, err := m.availableMigrations()
+		if err != nil {
+			return err
+		}
+
+		if err := m.checkChecksums(ctx, conn, checksums); err != nil {
+			return err
+		}
+
+		unapplied, err := m.unappliedMigrations(ctx, conn, available)
+		if err != nil {
+			return err
+		}
+
+		plan = &Plan{}
+		for _, mg := range unapplied {
+			migration := mg.asMigration()
+			if gm, ok := m.migrations[mg.Version]; ok {
+				migration = gm
+			}
+
+			plan.Migrations = append(plan.Migrations, PlannedMigration{
+				Migration: migration,
+				Direction: DirectionUp,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// withAdvisoryLock acquires a dedicated connection and a Postgres session
+// advisory lock scoped to this migrator's table, runs fn on that connection,
+// then releases the lock. This serializes concurrent MigrateUp/MigrateDown
+// calls against the same database, including from other app instances
+// starting up at the same time.
+func (m *migrator) withAdvisoryLock(ctx context.Context, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.lockTimeout > 0 {
+		deadline := time.Now().Add(m.lockTimeout)
+		for {
+			var acquired bool
+			if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", m.lockKey).Scan(&acquired); err != nil {
+				return err
+			}
+
+			if acquired {
+				break
+			}
+
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for migration advisory lock")
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(advisoryLockPollInterval):
+			}
+		}
+	} else if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockKey); err != nil {
+		return err
+	}
+
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", m.lockKey); err != nil {
+			m.logger.Warnf("failed to release migration advisory lock: %s", err)
+		}
+	}()
+
+	return fn(ctx, conn)
+}
+
+// beforeAll invokes the registered hooks' BeforeAll, if any, returning its
+// error unwrapped since no migration has run yet to identify.
+func (m *migrator) beforeAll(ctx context.Context, direction Direction) error {
+	if m.hooks == nil {
+		return nil
+	}
+
+	return m.hooks.BeforeAll(ctx, direction)
+}
+
+// afterAll invokes the registered hooks' AfterAll, if any, passing through
+// runErr (the error MigrateUp/MigrateDown is about to return). A hook error
+// takes precedence, so a failing notification can still surface as the
+// overall result.
+func (m *migrator) afterAll(ctx context.Context, direction Direction, runErr error) error {
+	if m.hooks == nil {
+		return runErr
+	}
+
+	if err := m.hooks.AfterAll(ctx, direction, runErr); err != nil {
+		return fmt.Errorf("after-all hook: %w", err)
+	}
+
+	return runErr
+}
+
+// beforeEach invokes the registered hooks' BeforeEach, if any, wrapping any
+// error so the offending migration version is identifiable.
+func (m *migrator) beforeEach(ctx context.Context, direction Direction, mg Migration) error {
+	if m.hooks == nil {
+		return nil
+	}
+
+	if err := m.hooks.BeforeEach(ctx, direction, mg); err != nil {
+		return fmt.Errorf("before hook for migration %s: %w", mg, err)
+	}
+
+	return nil
+}
+
+// afterEach invokes the registered hooks' AfterEach, if any, passing through
+// runErr (the migration's own execution error, if it failed). A hook error
+// takes precedence over runErr, aborting the batch even if the migration
+// itself succeeded, e.g. so an approval check can still veto it.
+func (m *migrator) afterEach(ctx context.Context, direction Direction, mg Migration, runErr error) error {
+	if m.hooks == nil {
+		return runErr
+	}
+
+	if err := m.hooks.AfterEach(ctx, direction, mg, runErr); err != nil {
+		return fmt.Errorf("after hook for migration %s: %w", mg, err)
+	}
+
+	return runErr
+}
+
+// applyNoTransactionMigration runs an up migration that carries the
+// no-transaction directive directly on conn, outside of any transaction,
+// then records it in __migrations in its own transaction.
+func (m *migrator) applyNoTransactionMigration(ctx context.Context, conn *sql.Conn, mg migrationFile, stmt []byte, checksum sql.NullString) error {
+	m.logger.Infof("applying migration %s (no-transaction)", mg)
+
+	start := time.Now()
+	if _, err := conn.ExecContext(ctx, string(stmt)); err != nil {
+		return err
+	}
+	executionMs := time.Since(start).Milliseconds()
+
+	bookkeepingTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := bookkeepingTx.ExecContext(
+		ctx,
+		"INSERT INTO __migrations (version, name, checksum, execution_ms) VALUES ($1, $2, $3, $4)",
+		mg.Version, mg.Name, checksum, executionMs,
+	); err != nil {
+		if rollbackErr := bookkeepingTx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("failed to rollback migration bookkeeping transaction: %w", rollbackErr)
+		}
+
+		return err
+	}
+
+	return bookkeepingTx.Commit()
+}
+
+// rollbackNoTransactionMigration runs a down migration that carries the
+// no-transaction directive directly on conn, outside of any transaction,
+// then removes it from __migrations in its own transaction.
+func (m *migrator) rollbackNoTransactionMigration(ctx context.Context, conn *sql.Conn, mg migrationFile, stmt []byte) error {
+	m.logger.Infof("rolling back migration %s (no-transaction)", mg)
+
+	if _, err := conn.ExecContext(ctx, string(stmt)); err != nil {
+		return err
+	}
+
+	bookkeepingTx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := bookkeepingTx.ExecContext(ctx, "DELETE FROM __migrations WHERE version = $1", mg.Version); err != nil {
+		if rollbackErr := bookkeepingTx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("failed to rollback migration bookkeeping transaction: %w", rollbackErr)
+		}
+
+		return err
+	}
+
+	return bookkeepingTx.Commit()
 }
 
 // MigrateDown will rollback all migrations that were applied after the specified version.
 func (m *migrator) MigrateDown(ctx context.Context, version int) error {
+	if err := m.beforeAll(ctx, DirectionDown); err != nil {
+		return err
+	}
+
+	err := m.withAdvisoryLock(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		return m.migrateDown(ctx, conn, version)
+	})
+
+	return m.afterAll(ctx, DirectionDown, err)
+}
+
+func (m *migrator) migrateDown(ctx context.Context, conn *sql.Conn, version int) error {
 	// Find which migrations were applied after the specified one
 	var res []byte
-	if err := m.db.QueryRowContext(
+	if err := conn.QueryRowContext(
 		ctx,
 		`SELECT json_agg(
 			sm
@@ -80,44 +765,121 @@ func (m *migrator) MigrateDown(ctx context.Context, version int) error {
 		return fmt.Errorf("no migrations to rollback")
 	}
 
-	tx, err := m.db.BeginTx(ctx, nil)
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
 	for _, mg := range rollbackMigrations {
-		downFilepath := filepath.Join(m.basePath,
-			fmt.Sprintf("%d_%s.down.sql", mg.Version, mg.Name),
-		)
+		if gm, ok := m.migrations[mg.Version]; ok {
+			if gm.DownFunc == nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
 
-		if _, err := os.Stat(downFilepath); err != nil {
-			if rollbackErr := tx.Rollback(); rollbackErr != nil {
-				return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				return fmt.Errorf("registered migration %s has no DownFunc", mg)
 			}
 
-			if os.IsNotExist(err) {
-				return fmt.Errorf("could not find down file for version %s", mg)
+			if err := m.beforeEach(ctx, DirectionDown, gm); err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return err
 			}
 
-			return err
-		}
+			m.logger.Infof("rolling back migration %s", mg)
+			downErr := gm.DownFunc(ctx, tx)
+			if err := m.afterEach(ctx, DirectionDown, gm, downErr); err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
 
-		mgSource, err := os.ReadFile(downFilepath)
-		if err != nil {
-			if rollbackErr := tx.Rollback(); rollbackErr != nil {
-				return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				return err
 			}
+		} else {
+			downFilename := fmt.Sprintf("%d_%s.down.sql", mg.Version, mg.Name)
+			downFilepath := path.Join(m.dir, downFilename)
 
-			return err
-		}
+			if _, err := fs.Stat(m.fsys, downFilepath); err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
 
-		m.logger.Infof("rolling back migration %s", mg)
-		if _, err := tx.ExecContext(ctx, string(mgSource)); err != nil {
-			if rollbackErr := tx.Rollback(); rollbackErr != nil {
-				return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				if errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("could not find down file for version %s", mg)
+				}
+
+				return err
 			}
 
-			return err
+			mgSource, err := fs.ReadFile(m.fsys, downFilepath)
+			if err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return err
+			}
+
+			stmt, noTransaction, err := m.prepareStatement(downFilename, mgSource)
+			if err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return err
+			}
+
+			mgAsMigration := mg.asMigration()
+
+			if noTransaction {
+				if m.dryRun {
+					return rejectDryRunNoTransaction(tx, mg)
+				}
+
+				if err := m.beforeEach(ctx, DirectionDown, mgAsMigration); err != nil {
+					if rollbackErr := tx.Rollback(); rollbackErr != nil {
+						return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+					}
+
+					return err
+				}
+
+				if err := tx.Commit(); err != nil {
+					return err
+				}
+
+				rollbackErr := m.rollbackNoTransactionMigration(ctx, conn, mg, stmt)
+				if err := m.afterEach(ctx, DirectionDown, mgAsMigration, rollbackErr); err != nil {
+					return fmt.Errorf("migration %s: %w", mg, err)
+				}
+
+				tx, err = conn.BeginTx(ctx, nil)
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := m.beforeEach(ctx, DirectionDown, mgAsMigration); err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return err
+			}
+
+			m.logger.Infof("rolling back migration %s", mg)
+			_, execErr := tx.ExecContext(ctx, string(stmt))
+			if err := m.afterEach(ctx, DirectionDown, mgAsMigration, execErr); err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return err
+			}
 		}
 
 		if _, err := tx.ExecContext(ctx, "DELETE FROM __migrations WHERE version = $1", mg.Version); err != nil {
@@ -129,65 +891,125 @@ func (m *migrator) MigrateDown(ctx context.Context, version int) error {
 		}
 	}
 
+	if m.dryRun {
+		m.logger.Infof("dry run: rolling back %d migration(s) instead of committing", len(rollbackMigrations))
+		return tx.Rollback()
+	}
+
 	return tx.Commit()
 }
 
 // MigrateUp will apply all available migrations that have not been applied yet.
 func (m *migrator) MigrateUp(ctx context.Context) error {
-	files, err := os.ReadDir(m.basePath)
-	if err != nil {
+	if err := m.beforeAll(ctx, DirectionUp); err != nil {
 		return err
 	}
 
+	err := m.withAdvisoryLock(ctx, m.migrateUp)
+
+	return m.afterAll(ctx, DirectionUp, err)
+}
+
+// MigrateTo brings the database to exactly targetVersion: it applies
+// unapplied migrations with a version <= targetVersion, in order, or, if
+// migrations have already been applied past targetVersion, delegates to
+// MigrateDown(ctx, targetVersion) instead. This gives callers a single "go
+// to this version" primitive for staged rollouts.
+func (m *migrator) MigrateTo(ctx context.Context, targetVersion int) error {
 	var (
-		availableMigrations []migrationFile
-		matches             []string
+		direction    Direction
+		beforeAllRan bool
 	)
 
-	// Find all available migrations (up files)
-	for _, f := range files {
-		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
-			continue
+	err := m.withAdvisoryLock(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		// Decide which way to go under the advisory lock, so a concurrent
+		// run can't apply past targetVersion between this check and the
+		// migration below.
+		var currentMax sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT MAX(version) FROM __migrations").Scan(&currentMax); err != nil {
+			return err
 		}
 
-		matches = m.fileRegex.FindStringSubmatch(f.Name())
-		if len(matches) < 4 {
-			m.logger.Warnf("file %s is not formatted correctly", f.Name())
-			continue
+		if currentMax.Valid && int(currentMax.Int64) > targetVersion {
+			direction = DirectionDown
+		} else {
+			direction = DirectionUp
 		}
 
-		if matches[3] != "up" {
-			continue
+		if err := m.beforeAll(ctx, direction); err != nil {
+			return err
 		}
+		beforeAllRan = true
 
-		v, err := strconv.Atoi(matches[1])
-		if err != nil {
-			return fmt.Errorf("failed extracting version for %s: %w", f.Name(), err)
+		if direction == DirectionDown {
+			return m.migrateDown(ctx, conn, targetVersion)
 		}
 
-		availableMigrations = append(availableMigrations, migrationFile{
-			Version: v,
-			Name:    matches[2],
-		})
+		return m.migrateUpTo(ctx, conn, &targetVersion)
+	})
+
+	// Mirror MigrateUp/MigrateDown: only call AfterAll once BeforeAll has
+	// actually run, so a hook pairing a span (or similar) in BeforeAll/
+	// AfterAll never sees an AfterAll without its matching BeforeAll, e.g.
+	// when acquiring the advisory lock or reading the current version fails
+	// before a direction is even chosen.
+	if !beforeAllRan {
+		return err
 	}
 
-	if len(availableMigrations) == 0 {
-		return ErrNoMigrations
+	return m.afterAll(ctx, direction, err)
+}
+
+// checkChecksums refuses to proceed if a previously applied migration's
+// on-disk contents have drifted since it was applied, unless
+// m.allowChecksumMismatch is set. Both migrateUpTo and Plan run this check
+// against the same checksums, so a clean Plan reliably predicts what
+// MigrateUp will do.
+func (m *migrator) checkChecksums(ctx context.Context, conn *sql.Conn, checksums map[int]string) error {
+	if m.allowChecksumMismatch {
+		return nil
 	}
 
-	// Find unapplied and diff migrations
-	inp, err := json.Marshal(availableMigrations)
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum FROM __migrations WHERE checksum IS NOT NULL")
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			v        int
+			checksum string
+		)
+		if err := rows.Scan(&v, &checksum); err != nil {
+			return err
+		}
+
+		if disk, ok := checksums[v]; ok && disk != checksum {
+			return fmt.Errorf("checksum mismatch for migration %d: file has changed since it was applied", v)
+		}
+	}
+
+	return rows.Err()
+}
+
+// unappliedMigrations compares available against what's recorded in
+// __migrations and returns the subset that still needs to be applied,
+// sorted by version. It also warns about migrations recorded in
+// __migrations that no longer exist on disk or in code.
+func (m *migrator) unappliedMigrations(ctx context.Context, conn *sql.Conn, available []migrationFile) ([]migrationFile, error) {
+	inp, err := json.Marshal(available)
+	if err != nil {
+		return nil, err
+	}
 
 	var (
 		unappliedRes []byte
 		diffRes      []byte
 	)
-	if err := m.db.QueryRowContext(
+	if err := conn.QueryRowContext(
 		ctx,
-		`SELECT 
+		`SELECT
 			(
 				SELECT
 				json_agg(x)
@@ -206,14 +1028,14 @@ func (m *migrator) MigrateUp(ctx context.Context) error {
 		`,
 		inp,
 	).Scan(&unappliedRes, &diffRes); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Find migrations that exist in the database but not on disk
 	if len(diffRes) > 0 {
 		var diffMigrations []migrationFile
 		if err := json.Unmarshal(diffRes, &diffMigrations); err != nil {
-			return err
+			return nil, err
 		}
 
 		if len(diffMigrations) > 0 {
@@ -226,15 +1048,63 @@ func (m *migrator) MigrateUp(ctx context.Context) error {
 	}
 
 	if len(unappliedRes) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	var unappliedMigrations []migrationFile
 	if err := json.Unmarshal(unappliedRes, &unappliedMigrations); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(unappliedMigrations, func(i, j int) bool {
+		return unappliedMigrations[i].Version < unappliedMigrations[j].Version
+	})
+
+	return unappliedMigrations, nil
+}
+
+// migrateUp applies every unapplied migration.
+func (m *migrator) migrateUp(ctx context.Context, conn *sql.Conn) error {
+	return m.migrateUpTo(ctx, conn, nil)
+}
+
+// migrateUpTo applies unapplied migrations, restricted to those with a
+// version <= *maxVersion when maxVersion is non-nil. It backs both
+// MigrateUp (maxVersion nil) and MigrateTo.
+func (m *migrator) migrateUpTo(ctx context.Context, conn *sql.Conn, maxVersion *int) error {
+	availableMigrations, checksums, err := m.availableMigrations()
+	if err != nil {
+		return err
+	}
+
+	if len(availableMigrations) == 0 {
+		return ErrNoMigrations
+	}
+
+	if err := m.checkChecksums(ctx, conn, checksums); err != nil {
 		return err
 	}
 
-	tx, err := m.db.BeginTx(ctx, nil)
+	unappliedMigrations, err := m.unappliedMigrations(ctx, conn, availableMigrations)
+	if err != nil {
+		return err
+	}
+
+	if maxVersion != nil {
+		filtered := unappliedMigrations[:0]
+		for _, mg := range unappliedMigrations {
+			if mg.Version <= *maxVersion {
+				filtered = append(filtered, mg)
+			}
+		}
+		unappliedMigrations = filtered
+	}
+
+	if len(unappliedMigrations) == 0 {
+		return nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -242,10 +1112,48 @@ func (m *migrator) MigrateUp(ctx context.Context) error {
 	// Apply each one of the unapplied migrations
 	var migrationFilename string
 	for _, mg := range unappliedMigrations {
+		checksum := sql.NullString{String: checksums[mg.Version], Valid: checksums[mg.Version] != ""}
+
+		if gm, ok := m.migrations[mg.Version]; ok {
+			if gm.UpFunc == nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return fmt.Errorf("registered migration %s has no UpFunc", mg)
+			}
+
+			if err := m.beforeEach(ctx, DirectionUp, gm); err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return err
+			}
+
+			m.logger.Infof("applying migration %s", mg)
+
+			start := time.Now()
+			upErr := gm.UpFunc(ctx, tx)
+			if err := m.afterEach(ctx, DirectionUp, gm, upErr); err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return err
+			}
+
+			if err := m.recordMigration(ctx, tx, mg, checksum, time.Since(start).Milliseconds()); err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		migrationFilename = fmt.Sprintf("%d_%s.up.sql", mg.Version, mg.Name)
 
 		// Read migration source from disk
-		mgSource, err := os.ReadFile(filepath.Join(m.basePath, migrationFilename))
+		mgSource, err := fs.ReadFile(m.fsys, path.Join(m.dir, migrationFilename))
 		if err != nil {
 			if rollbackErr := tx.Rollback(); rollbackErr != nil {
 				return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
@@ -254,13 +1162,48 @@ func (m *migrator) MigrateUp(ctx context.Context) error {
 			return err
 		}
 
-		m.logger.Infof("applying migration %s", mg)
+		stmt, noTransaction, err := m.prepareStatement(migrationFilename, mgSource)
+		if err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+			}
 
-		// Apply migration source
-		if _, err := tx.ExecContext(
-			ctx,
-			string(mgSource),
-		); err != nil {
+			return err
+		}
+
+		mgAsMigration := mg.asMigration()
+
+		if noTransaction {
+			if m.dryRun {
+				return rejectDryRunNoTransaction(tx, mg)
+			}
+
+			if err := m.beforeEach(ctx, DirectionUp, mgAsMigration); err != nil {
+				if rollbackErr := tx.Rollback(); rollbackErr != nil {
+					return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+				}
+
+				return err
+			}
+
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+
+			applyErr := m.applyNoTransactionMigration(ctx, conn, mg, stmt, checksum)
+			if err := m.afterEach(ctx, DirectionUp, mgAsMigration, applyErr); err != nil {
+				return fmt.Errorf("migration %s: %w", mg, err)
+			}
+
+			tx, err = conn.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := m.beforeEach(ctx, DirectionUp, mgAsMigration); err != nil {
 			if rollbackErr := tx.Rollback(); rollbackErr != nil {
 				return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
 			}
@@ -268,24 +1211,76 @@ func (m *migrator) MigrateUp(ctx context.Context) error {
 			return err
 		}
 
-		// Add migration to __migrations table
-		if _, err := tx.ExecContext(
-			ctx,
-			"INSERT INTO __migrations (version, name) VALUES ($1, $2)",
-			mg.Version,
-			mg.Name,
-		); err != nil {
+		m.logger.Infof("applying migration %s", mg)
+
+		// Apply migration source
+		start := time.Now()
+		_, execErr := tx.ExecContext(ctx, string(stmt))
+		if err := m.afterEach(ctx, DirectionUp, mgAsMigration, execErr); err != nil {
 			if rollbackErr := tx.Rollback(); rollbackErr != nil {
 				return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
 			}
 
 			return err
 		}
+
+		if err := m.recordMigration(ctx, tx, mg, checksum, time.Since(start).Milliseconds()); err != nil {
+			return err
+		}
+	}
+
+	if m.dryRun {
+		m.logger.Infof("dry run: rolling back %d migration(s) instead of committing", len(unappliedMigrations))
+		return tx.Rollback()
 	}
 
 	return tx.Commit()
 }
 
+// rejectDryRunNoTransaction rolls back tx and returns an error for a
+// no-transaction migration hit while m.dryRun is set: such migrations run
+// outside any transaction, so there's nothing for a dry run to roll back.
+func rejectDryRunNoTransaction(tx *sql.Tx, mg migrationFile) error {
+	if rollbackErr := tx.Rollback(); rollbackErr != nil {
+		return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+	}
+
+	return fmt.Errorf("cannot dry-run migration %s: no-transaction migrations execute outside a transaction and can't be rolled back", mg)
+}
+
+// recordMigration inserts a completed migration's bookkeeping row into
+// __migrations, rolling back tx the same way a failed migration would if the
+// insert itself fails.
+func (m *migrator) recordMigration(ctx context.Context, tx *sql.Tx, mg migrationFile, checksum sql.NullString, executionMs int64) error {
+	if _, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO __migrations (version, name, checksum, execution_ms) VALUES ($1, $2, $3, $4)",
+		mg.Version,
+		mg.Name,
+		checksum,
+		executionMs,
+	); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("failed to rollback migration transaction: %w", rollbackErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
 func (m migrationFile) String() string {
 	return fmt.Sprintf("%d_%s", m.Version, m.Name)
 }
+
+// asMigration adapts an on-disk migrationFile to the exported Migration type
+// so it can be passed to Hooks alongside migrations registered in code.
+// UpFunc/DownFunc are left nil; hooks only need the version and name.
+func (mg migrationFile) asMigration() Migration {
+	return Migration{Version: mg.Version, Name: mg.Name}
+}
+
+func (mg Migration) String() string {
+	return fmt.Sprintf("%d_%s", mg.Version, mg.Name)
+}
@@ -3,14 +3,21 @@ package test
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"reflect"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	migrate "github.com/zanmato/pgmigrate"
 )
 
+var testdataFS = os.DirFS("./testdata")
+
 type logger struct {
 	t *testing.T
 }
@@ -169,3 +176,643 @@ func TestMigrateDown(t *testing.T) {
 		}
 	}
 }
+
+func TestMigrateUpFS(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_1, test_table_2")
+	})
+
+	mg, err := migrate.NewMigratorFS(db, l, testdataFS, "migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	var exists bool
+	db.QueryRow(
+		`SELECT EXISTS (
+			SELECT *
+			FROM __migrations
+			WHERE version = $1 AND name = $2
+		);`,
+		2023100100,
+		"test",
+	).Scan(&exists)
+	if !exists {
+		t.Errorf("expected migration to exist when sourced from an fs.FS")
+	}
+}
+
+func TestMigrateUpRegistered(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_1, test_table_2, test_table_go")
+	})
+
+	mg, err := migrate.NewMigrator(db, l, "./testdata/migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.Register(migrate.Migration{
+		Version: 2023100099,
+		Name:    "go_migration",
+		UpFunc: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "CREATE TABLE test_table_go (id serial PRIMARY KEY)")
+			return err
+		},
+		DownFunc: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, "DROP TABLE test_table_go")
+			return err
+		},
+	}); err != nil {
+		t.Fatalf("unable to register migration: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	var exists bool
+	db.QueryRow(
+		`SELECT EXISTS (
+			SELECT *
+			FROM pg_tables
+			WHERE schemaname = 'public' AND tablename = 'test_table_go'
+		);`,
+	).Scan(&exists)
+	if !exists {
+		t.Errorf("expected registered Go migration to have run")
+	}
+
+	if err := mg.MigrateDown(context.Background(), 2023100098); err != nil {
+		t.Fatalf("unable to migrate down: %s", err)
+	}
+
+	db.QueryRow(
+		`SELECT EXISTS (
+			SELECT *
+			FROM pg_tables
+			WHERE schemaname = 'public' AND tablename = 'test_table_go'
+		);`,
+	).Scan(&exists)
+	if exists {
+		t.Errorf("expected registered Go migration to have been rolled back")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_1, test_table_2")
+	})
+
+	mg, err := migrate.NewMigrator(db, l, "./testdata/migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	statuses, err := mg.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unable to fetch status: %s", err)
+	}
+
+	for _, s := range statuses {
+		if !s.Applied || !s.Available || !s.ChecksumMatch {
+			t.Errorf("expected migration %d to be applied, available and checksum-matching, got %+v", s.Version, s)
+		}
+		if s.AppliedAt == nil {
+			t.Errorf("expected migration %d to have an applied_at timestamp", s.Version)
+		}
+	}
+}
+
+func TestStatusAndMigrateUpChecksumMismatch(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_checksum")
+	})
+
+	fsys := fstest.MapFS{
+		"migrations/2023100600_create.up.sql": &fstest.MapFile{
+			Data: []byte("CREATE TABLE test_table_checksum (id int NOT NULL);"),
+		},
+		"migrations/2023100600_create.down.sql": &fstest.MapFile{
+			Data: []byte("DROP TABLE test_table_checksum;"),
+		},
+	}
+
+	mg, err := migrate.NewMigratorFS(db, l, fsys, "migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	// Mutate the on-disk migration after it's been applied, so its checksum
+	// no longer matches what was recorded in __migrations.
+	fsys["migrations/2023100600_create.up.sql"] = &fstest.MapFile{
+		Data: []byte("CREATE TABLE test_table_checksum (id int NOT NULL, extra_column text);"),
+	}
+
+	statuses, err := mg.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unable to fetch status: %s", err)
+	}
+
+	var found bool
+	for _, s := range statuses {
+		if s.Version != 2023100600 {
+			continue
+		}
+
+		found = true
+		if s.ChecksumMatch {
+			t.Errorf("expected Status to flag a mutated migration as checksum mismatch, got %+v", s)
+		}
+	}
+	if !found {
+		t.Fatalf("expected a status entry for migration 2023100600")
+	}
+
+	if err := mg.MigrateUp(context.Background()); err == nil {
+		t.Errorf("expected MigrateUp to refuse to proceed with a checksum mismatch")
+	}
+
+	allowMg, err := migrate.NewMigratorFS(db, l, fsys, "migrations", migrate.WithAllowChecksumMismatch())
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := allowMg.MigrateUp(context.Background()); err != nil {
+		t.Errorf("expected MigrateUp to proceed past a checksum mismatch with WithAllowChecksumMismatch: %s", err)
+	}
+}
+
+func TestMigrateUpConcurrent(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_1, test_table_2")
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			mg, err := migrate.NewMigrator(db, l, "./testdata/migrations", migrate.WithLockTimeout(5*time.Second))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			errs[i] = mg.MigrateUp(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("concurrent MigrateUp failed: %s", err)
+		}
+	}
+}
+
+func TestMigrateUpNoTransactionDirective(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_concurrent")
+	})
+
+	fsys := fstest.MapFS{
+		"migrations/2023100200_create.up.sql": &fstest.MapFile{
+			Data: []byte("CREATE TABLE test_table_concurrent (id int NOT NULL);"),
+		},
+		"migrations/2023100200_create.down.sql": &fstest.MapFile{
+			Data: []byte("DROP TABLE test_table_concurrent;"),
+		},
+		"migrations/2023100201_index_concurrently.up.sql": &fstest.MapFile{
+			Data: []byte("-- pgmigrate:no-transaction\nCREATE INDEX CONCURRENTLY idx_test_table_concurrent_id ON test_table_concurrent(id);"),
+		},
+		"migrations/2023100201_index_concurrently.down.sql": &fstest.MapFile{
+			Data: []byte("-- pgmigrate:no-transaction\nDROP INDEX CONCURRENTLY idx_test_table_concurrent_id;"),
+		},
+	}
+
+	mg, err := migrate.NewMigratorFS(db, l, fsys, "migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	var exists bool
+	db.QueryRow(
+		`SELECT EXISTS (
+			SELECT * FROM pg_indexes WHERE indexname = 'idx_test_table_concurrent_id'
+		);`,
+	).Scan(&exists)
+	if !exists {
+		t.Errorf("expected index created via CREATE INDEX CONCURRENTLY to exist")
+	}
+
+	if err := mg.MigrateDown(context.Background(), 2023100200); err != nil {
+		t.Fatalf("unable to migrate down: %s", err)
+	}
+}
+
+func TestMigrateUpTemplateData(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_templated")
+	})
+
+	fsys := fstest.MapFS{
+		"migrations/2023100300_create.up.sql": &fstest.MapFile{
+			Data: []byte("CREATE TABLE {{ .TableName }} (id int NOT NULL);"),
+		},
+		"migrations/2023100300_create.down.sql": &fstest.MapFile{
+			Data: []byte("DROP TABLE {{ .TableName }};"),
+		},
+	}
+
+	mg, err := migrate.NewMigratorFS(db, l, fsys, "migrations", migrate.WithTemplateData(map[string]any{
+		"TableName": "test_table_templated",
+	}))
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	var exists bool
+	db.QueryRow(
+		`SELECT EXISTS (
+			SELECT * FROM pg_tables WHERE schemaname = 'public' AND tablename = 'test_table_templated'
+		);`,
+	).Scan(&exists)
+	if !exists {
+		t.Errorf("expected templated table name to have been substituted")
+	}
+}
+
+// recordingHooks implements migrate.Hooks, appending a label for every call
+// it receives so tests can assert on call order. If err is set, it's
+// returned from BeforeEach.
+type recordingHooks struct {
+	mu    sync.Mutex
+	calls []string
+	err   error
+}
+
+func (h *recordingHooks) record(label string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, label)
+}
+
+func (h *recordingHooks) BeforeAll(ctx context.Context, direction migrate.Direction) error {
+	h.record(fmt.Sprintf("before-all:%s", direction))
+	return nil
+}
+
+func (h *recordingHooks) AfterAll(ctx context.Context, direction migrate.Direction, err error) error {
+	h.record(fmt.Sprintf("after-all:%s", direction))
+	return nil
+}
+
+func (h *recordingHooks) BeforeEach(ctx context.Context, direction migrate.Direction, mg migrate.Migration) error {
+	h.record(fmt.Sprintf("before-each:%s:%d", direction, mg.Version))
+	return h.err
+}
+
+func (h *recordingHooks) AfterEach(ctx context.Context, direction migrate.Direction, mg migrate.Migration, err error) error {
+	h.record(fmt.Sprintf("after-each:%s:%d", direction, mg.Version))
+	return nil
+}
+
+func TestMigrateUpHooks(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_1, test_table_2")
+	})
+
+	h := &recordingHooks{}
+
+	mg, err := migrate.NewMigrator(db, l, "./testdata/migrations", migrate.WithHooks(h))
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	want := []string{
+		"before-all:up",
+		"before-each:up:2023100100",
+		"after-each:up:2023100100",
+		"before-each:up:2023100101",
+		"after-each:up:2023100101",
+		"after-all:up",
+	}
+	if !reflect.DeepEqual(h.calls, want) {
+		t.Errorf("unexpected hook call order\n got: %v\nwant: %v", h.calls, want)
+	}
+}
+
+func TestMigrateUpHooksAbort(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_1, test_table_2")
+	})
+
+	h := &recordingHooks{err: fmt.Errorf("approval required")}
+
+	mg, err := migrate.NewMigrator(db, l, "./testdata/migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+	mg.OnEvent(h)
+
+	if err := mg.MigrateUp(context.Background()); err == nil {
+		t.Fatalf("expected MigrateUp to fail when BeforeEach returns an error")
+	}
+
+	var exists bool
+	db.QueryRow(
+		`SELECT EXISTS (
+			SELECT * FROM pg_tables WHERE schemaname = 'public' AND tablename = 'test_table_1'
+		);`,
+	).Scan(&exists)
+	if exists {
+		t.Errorf("expected migration to have been rolled back after a hook error")
+	}
+}
+
+func TestMigrateTo(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_1, test_table_2")
+	})
+
+	mg, err := migrate.NewMigrator(db, l, "./testdata/migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateTo(context.Background(), 2023100100); err != nil {
+		t.Fatalf("unable to migrate to version: %s", err)
+	}
+
+	var table1Exists, table2Exists bool
+	db.QueryRow(`SELECT EXISTS (SELECT * FROM pg_tables WHERE schemaname = 'public' AND tablename = 'test_table_1')`).Scan(&table1Exists)
+	db.QueryRow(`SELECT EXISTS (SELECT * FROM pg_tables WHERE schemaname = 'public' AND tablename = 'test_table_2')`).Scan(&table2Exists)
+	if !table1Exists {
+		t.Errorf("expected migration up to the target version to have applied")
+	}
+	if table2Exists {
+		t.Errorf("expected migration past the target version to not have applied")
+	}
+
+	if err := mg.MigrateTo(context.Background(), 2023100101); err != nil {
+		t.Fatalf("unable to migrate to later version: %s", err)
+	}
+
+	db.QueryRow(`SELECT EXISTS (SELECT * FROM pg_tables WHERE schemaname = 'public' AND tablename = 'test_table_2')`).Scan(&table2Exists)
+	if !table2Exists {
+		t.Errorf("expected a later MigrateTo call to apply the remaining migrations")
+	}
+
+	if err := mg.MigrateTo(context.Background(), 2023100100); err != nil {
+		t.Fatalf("unable to migrate back down to an earlier version: %s", err)
+	}
+
+	db.QueryRow(`SELECT EXISTS (SELECT * FROM pg_tables WHERE schemaname = 'public' AND tablename = 'test_table_2')`).Scan(&table2Exists)
+	if table2Exists {
+		t.Errorf("expected MigrateTo an earlier version to roll back migrations above it")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_1, test_table_2")
+	})
+
+	mg, err := migrate.NewMigrator(db, l, "./testdata/migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	plan, err := mg.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("unable to compute plan: %s", err)
+	}
+
+	wantVersions := []int{2023100100, 2023100101}
+	if len(plan.Migrations) != len(wantVersions) {
+		t.Fatalf("expected %d planned migrations, got %d: %+v", len(wantVersions), len(plan.Migrations), plan.Migrations)
+	}
+	for i, v := range wantVersions {
+		step := plan.Migrations[i]
+		if step.Migration.Version != v || step.Direction != migrate.DirectionUp {
+			t.Errorf("expected step %d to be up migration %d, got %+v", i, v, step)
+		}
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	plan, err = mg.Plan(context.Background())
+	if err != nil {
+		t.Fatalf("unable to compute plan after migrating up: %s", err)
+	}
+	if len(plan.Migrations) != 0 {
+		t.Errorf("expected no pending migrations after MigrateUp, got %+v", plan.Migrations)
+	}
+}
+
+func TestMigrateUpDryRun(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_dry_run")
+	})
+
+	fsys := fstest.MapFS{
+		"migrations/2023100400_create.up.sql": &fstest.MapFile{
+			Data: []byte("CREATE TABLE test_table_dry_run (id int NOT NULL);"),
+		},
+		"migrations/2023100400_create.down.sql": &fstest.MapFile{
+			Data: []byte("DROP TABLE test_table_dry_run;"),
+		},
+	}
+
+	mg, err := migrate.NewMigratorFS(db, l, fsys, "migrations", migrate.WithDryRun())
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to run dry-run migrate up: %s", err)
+	}
+
+	var tableExists, recorded bool
+	db.QueryRow(`SELECT EXISTS (SELECT * FROM pg_tables WHERE schemaname = 'public' AND tablename = 'test_table_dry_run')`).Scan(&tableExists)
+	if tableExists {
+		t.Errorf("expected dry run to roll back the table creation")
+	}
+
+	db.QueryRow(`SELECT EXISTS (SELECT * FROM __migrations WHERE version = $1)`, 2023100400).Scan(&recorded)
+	if recorded {
+		t.Errorf("expected dry run to roll back the __migrations bookkeeping row")
+	}
+}
+
+func TestMigrateDownDryRun(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_dry_run_down")
+	})
+
+	fsys := fstest.MapFS{
+		"migrations/2023100401_create.up.sql": &fstest.MapFile{
+			Data: []byte("CREATE TABLE test_table_dry_run_down (id int NOT NULL);"),
+		},
+		"migrations/2023100401_create.down.sql": &fstest.MapFile{
+			Data: []byte("DROP TABLE test_table_dry_run_down;"),
+		},
+	}
+
+	mg, err := migrate.NewMigratorFS(db, l, fsys, "migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	dryMg, err := migrate.NewMigratorFS(db, l, fsys, "migrations", migrate.WithDryRun())
+	if err != nil {
+		t.Fatalf("unable to create dry-run migrator: %s", err)
+	}
+
+	if err := dryMg.MigrateDown(context.Background(), 2023100400); err != nil {
+		t.Fatalf("unable to run dry-run migrate down: %s", err)
+	}
+
+	var tableExists, recorded bool
+	db.QueryRow(`SELECT EXISTS (SELECT * FROM pg_tables WHERE schemaname = 'public' AND tablename = 'test_table_dry_run_down')`).Scan(&tableExists)
+	if !tableExists {
+		t.Errorf("expected dry run to roll back the table drop, leaving the table in place")
+	}
+
+	db.QueryRow(`SELECT EXISTS (SELECT * FROM __migrations WHERE version = $1)`, 2023100401).Scan(&recorded)
+	if !recorded {
+		t.Errorf("expected dry run to roll back the __migrations bookkeeping delete")
+	}
+}
+
+func TestMigrateUpDryRunRejectsNoTransaction(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_dry_run_notx")
+	})
+
+	fsys := fstest.MapFS{
+		"migrations/2023100402_create.up.sql": &fstest.MapFile{
+			Data: []byte("CREATE TABLE test_table_dry_run_notx (id int NOT NULL);"),
+		},
+		"migrations/2023100402_create.down.sql": &fstest.MapFile{
+			Data: []byte("DROP TABLE test_table_dry_run_notx;"),
+		},
+		"migrations/2023100403_index_concurrently.up.sql": &fstest.MapFile{
+			Data: []byte("-- pgmigrate:no-transaction\nCREATE INDEX CONCURRENTLY idx_test_table_dry_run_notx_id ON test_table_dry_run_notx(id);"),
+		},
+		"migrations/2023100403_index_concurrently.down.sql": &fstest.MapFile{
+			Data: []byte("-- pgmigrate:no-transaction\nDROP INDEX CONCURRENTLY idx_test_table_dry_run_notx_id;"),
+		},
+	}
+
+	mg, err := migrate.NewMigratorFS(db, l, fsys, "migrations", migrate.WithDryRun())
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err == nil {
+		t.Fatalf("expected dry-run MigrateUp to reject a no-transaction migration")
+	}
+}
+
+func TestMigrateDownDryRunRejectsNoTransaction(t *testing.T) {
+	l := &logger{t: t}
+
+	t.Cleanup(func() {
+		db.Exec("DROP TABLE IF EXISTS __migrations, test_table_dry_run_notx_down")
+	})
+
+	fsys := fstest.MapFS{
+		"migrations/2023100404_create.up.sql": &fstest.MapFile{
+			Data: []byte("CREATE TABLE test_table_dry_run_notx_down (id int NOT NULL);"),
+		},
+		"migrations/2023100404_create.down.sql": &fstest.MapFile{
+			Data: []byte("DROP TABLE test_table_dry_run_notx_down;"),
+		},
+		"migrations/2023100405_index_concurrently.up.sql": &fstest.MapFile{
+			Data: []byte("-- pgmigrate:no-transaction\nCREATE INDEX CONCURRENTLY idx_test_table_dry_run_notx_down_id ON test_table_dry_run_notx_down(id);"),
+		},
+		"migrations/2023100405_index_concurrently.down.sql": &fstest.MapFile{
+			Data: []byte("-- pgmigrate:no-transaction\nDROP INDEX CONCURRENTLY idx_test_table_dry_run_notx_down_id;"),
+		},
+	}
+
+	mg, err := migrate.NewMigratorFS(db, l, fsys, "migrations")
+	if err != nil {
+		t.Fatalf("unable to create migrator: %s", err)
+	}
+
+	if err := mg.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("unable to migrate up: %s", err)
+	}
+
+	dryMg, err := migrate.NewMigratorFS(db, l, fsys, "migrations", migrate.WithDryRun())
+	if err != nil {
+		t.Fatalf("unable to create dry-run migrator: %s", err)
+	}
+
+	if err := dryMg.MigrateDown(context.Background(), 2023100404); err == nil {
+		t.Fatalf("expected dry-run MigrateDown to reject a no-transaction migration")
+	}
+}